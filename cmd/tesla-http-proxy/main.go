@@ -3,35 +3,70 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/teslamotors/vehicle-command/internal/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
 	"github.com/teslamotors/vehicle-command/pkg/cli"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
 	"github.com/teslamotors/vehicle-command/pkg/proxy"
 )
 
 const (
-	cacheSize = 10000 // Number of cached vehicle sessions
-	defaultPort = 8080
+	cacheSize        = 10000 // Number of cached vehicle sessions
+	defaultPort      = 8080
 	defaultPortHTTPS = 8443
 )
 
 const (
-	EnvTLSCert = "TESLA_HTTP_PROXY_TLS_CERT"
-	EnvTLSKey  = "TESLA_HTTP_PROXY_TLS_KEY"
-	EnvHost    = "TESLA_HTTP_PROXY_HOST"
-	EnvPort    = "TESLA_HTTP_PROXY_PORT"
-	EnvTimeout = "TESLA_HTTP_PROXY_TIMEOUT"
-	EnvVerbose = "TESLA_VERBOSE"
+	EnvTLSCert    = "TESLA_HTTP_PROXY_TLS_CERT"
+	EnvTLSKey     = "TESLA_HTTP_PROXY_TLS_KEY"
+	EnvHost       = "TESLA_HTTP_PROXY_HOST"
+	EnvPort       = "TESLA_HTTP_PROXY_PORT"
+	EnvTimeout    = "TESLA_HTTP_PROXY_TIMEOUT"
+	EnvVerbose    = "TESLA_VERBOSE"
 	EnvDisableTLS = "TESLA_HTTP_PROXY_DISABLE_TLS"
+
+	EnvAutocert      = "TESLA_HTTP_PROXY_AUTOCERT"
+	EnvAutocertHosts = "TESLA_HTTP_PROXY_AUTOCERT_HOSTS"
+	EnvAutocertCache = "TESLA_HTTP_PROXY_AUTOCERT_CACHE"
+
+	EnvClientCA            = "TESLA_HTTP_PROXY_CLIENT_CA"
+	EnvRequireClientCert   = "TESLA_HTTP_PROXY_REQUIRE_CLIENT_CERT"
+	EnvClientAllowlistFile = "TESLA_HTTP_PROXY_CLIENT_ALLOWLIST_FILE"
+
+	EnvShutdownTimeout  = "TESLA_HTTP_PROXY_SHUTDOWN_TIMEOUT"
+	EnvAdminAddr        = "TESLA_HTTP_PROXY_ADMIN_ADDR"
+	EnvSessionCacheFile = "TESLA_HTTP_PROXY_SESSION_CACHE_FILE"
+
+	EnvMetricsAddr = "TESLA_HTTP_PROXY_METRICS_ADDR"
+
+	EnvUpstreamProxy        = "TESLA_HTTP_PROXY_UPSTREAM_PROXY"
+	EnvUpstreamCA           = "TESLA_HTTP_PROXY_UPSTREAM_CA"
+	EnvUpstreamProxyMapFile = "TESLA_HTTP_PROXY_UPSTREAM_PROXY_MAP_FILE"
 )
 
+// defaultShutdownTimeout bounds how long the server waits for in-flight requests to finish
+// during a graceful shutdown before forcibly closing their connections.
+const defaultShutdownTimeout = 10 * time.Second
+
+// autocertHTTPAddr is the address on which ACME HTTP-01 challenges are served. The ACME
+// protocol requires challenges to be answered on port 80.
+const autocertHTTPAddr = ":80"
+
 const nonLocalhostWarning = `
 Do not listen on a network interface without adding client authentication. Unauthorized clients may
 be used to create excessive traffic from your IP address to Tesla's servers, which Tesla may respond
@@ -44,6 +79,25 @@ type HTTProxyConfig struct {
 	host         string
 	port         int
 	timeout      time.Duration
+
+	autocert      bool
+	autocertHosts string
+	autocertCache string
+	certDir       string
+
+	clientCA            string
+	requireClientCert   bool
+	clientAllowlistFile string
+
+	shutdownTimeout  time.Duration
+	adminAddr        string
+	sessionCacheFile string
+
+	metricsAddr string
+
+	upstreamProxy        string
+	upstreamCA           string
+	upstreamProxyMapFile string
 }
 
 var (
@@ -57,6 +111,20 @@ func init() {
 	flag.StringVar(&httpConfig.host, "host", "localhost", "Proxy server `hostname`")
 	flag.IntVar(&httpConfig.port, "port", defaultPort, "`Port` to listen on")
 	flag.DurationVar(&httpConfig.timeout, "timeout", proxy.DefaultTimeout, "Timeout interval when sending commands")
+	flag.BoolVar(&httpConfig.autocert, "autocert", false, "Automatically obtain and renew a TLS certificate via ACME (Let's Encrypt)")
+	flag.StringVar(&httpConfig.autocertHosts, "autocert-hosts", "", "Comma-separated `hostnames` to request an autocert certificate for")
+	flag.StringVar(&httpConfig.autocertCache, "autocert-cache", "/var/cache/tesla-proxy", "`Directory` used to cache autocert certificates")
+	flag.StringVar(&httpConfig.certDir, "cert-dir", "", "`Directory` to watch for <hostname>.crt/.key pairs provided by an external renewal process")
+	flag.StringVar(&httpConfig.clientCA, "client-ca", "", "PEM-encoded client CA bundle `file` used to authenticate clients via mTLS")
+	flag.BoolVar(&httpConfig.requireClientCert, "require-client-cert", false, "Reject requests that do not present a certificate signed by --client-ca")
+	flag.StringVar(&httpConfig.clientAllowlistFile, "client-allowlist-file", "", "JSON `file` mapping each authenticated client's common name to the VINs it may address (see SetClientAllowlist)")
+	flag.DurationVar(&httpConfig.shutdownTimeout, "shutdown-timeout", defaultShutdownTimeout, "How long to wait for in-flight requests to finish during a graceful shutdown")
+	flag.StringVar(&httpConfig.adminAddr, "admin-addr", "", "If set, serve /healthz and /readyz on this separate `address` instead of the main listener")
+	flag.StringVar(&httpConfig.sessionCacheFile, "session-cache-file", "", "`File` used to persist the vehicle session cache across restarts")
+	flag.StringVar(&httpConfig.metricsAddr, "metrics-addr", "", "If set, serve Prometheus metrics on this `address`")
+	flag.StringVar(&httpConfig.upstreamProxy, "upstream-proxy", "", "`URL` of an HTTP/HTTPS proxy to use when calling Tesla's API, with optional basic-auth userinfo")
+	flag.StringVar(&httpConfig.upstreamCA, "upstream-ca", "", "PEM-encoded CA bundle `file` to additionally trust when calling Tesla's API")
+	flag.StringVar(&httpConfig.upstreamProxyMapFile, "upstream-proxy-map-file", "", "JSON `file` mapping VINs to a per-vehicle upstream proxy URL (see SetVehicleUpstreamProxy)")
 }
 
 func Usage() {
@@ -107,12 +175,18 @@ func main() {
 	}
 	config.ReadFromEnvironment()
 
+	logLevel := slog.LevelInfo
 	if httpConfig.verbose {
-		log.SetLevel(log.LevelDebug)
+		logLevel = slog.LevelDebug
 	}
+	opLogger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
 
 	if httpConfig.host != "localhost" {
 		fmt.Fprintln(os.Stderr, nonLocalhostWarning)
+		if !clientAuthConfigured() {
+			fmt.Fprintln(os.Stderr, "Refusing to start: use --client-ca together with --require-client-cert to require client authentication, or bind --host=localhost and put an authenticating reverse proxy in front.")
+			os.Exit(1)
+		}
 	}
 
 	var skey protocol.ECDHPrivateKey
@@ -136,27 +210,150 @@ func main() {
 				fmt.Fprintln(os.Stderr, "Generate a new TLS key for this server.")
 				return
 			}
-			log.Debug("Verified that TLS key is not the same as the command-authentication key.")
+			opLogger.Debug("verified that TLS key is not the same as the command-authentication key")
 		} else {
 			// Discarding the error here is deliberate
-			log.Debug("Verified that TLS key is not a recycled command-authentication key, because it is not NIST P256.")
+			opLogger.Debug("verified that TLS key is not a recycled command-authentication key, because it is not NIST P256")
+		}
+	}
+
+	if httpConfig.autocert && httpConfig.certFilename != "" {
+		fmt.Fprintln(os.Stderr, "--autocert cannot be combined with --cert")
+		return
+	}
+
+	registry := prometheus.NewRegistry()
+	opts := []proxy.Option{proxy.WithMetricsCollector(proxy.NewPrometheusCollector(registry))}
+
+	if httpConfig.upstreamProxy != "" {
+		var upstreamProxyURL *url.URL
+		upstreamProxyURL, err = url.Parse(httpConfig.upstreamProxy)
+		if err != nil {
+			return
 		}
+		opts = append(opts, proxy.WithUpstreamProxy(upstreamProxyURL))
 	}
 
-	log.Debug("Creating proxy")
-	p, err := proxy.New(context.Background(), skey, cacheSize)
+	if httpConfig.upstreamCA != "" {
+		var upstreamCA []byte
+		upstreamCA, err = proxy.LoadUpstreamCA(httpConfig.upstreamCA)
+		if err != nil {
+			return
+		}
+		opts = append(opts, proxy.WithUpstreamCA(upstreamCA))
+	}
+
+	opLogger.Debug("creating proxy")
+	p, err := proxy.New(context.Background(), skey, cacheSize, append(opts, proxy.WithLogger(opLogger))...)
 	if err != nil {
-		log.Error("Error initializing proxy service: %v", err)
+		opLogger.Error("initializing proxy service", slog.Any("error", err))
 		return
 	}
 	p.Timeout = httpConfig.timeout
+
+	if httpConfig.metricsAddr != "" {
+		metricsServer := &http.Server{Addr: httpConfig.metricsAddr, Handler: promhttp.HandlerFor(registry, promhttp.HandlerOpts{})}
+		go func() {
+			opLogger.Error("metrics server stopped", slog.Any("error", metricsServer.ListenAndServe()))
+		}()
+	}
+
+	if httpConfig.sessionCacheFile != "" {
+		if err := p.LoadSessions(httpConfig.sessionCacheFile); err != nil {
+			opLogger.Error("loading session cache", slog.String("path", httpConfig.sessionCacheFile), slog.Any("error", err))
+		}
+	}
+
+	if httpConfig.clientAllowlistFile != "" {
+		var allowlist map[string][]string
+		allowlist, err = loadClientAllowlist(httpConfig.clientAllowlistFile)
+		if err != nil {
+			opLogger.Error("loading client allowlist", slog.String("path", httpConfig.clientAllowlistFile), slog.Any("error", err))
+			return
+		}
+		if httpConfig.clientCA == "" {
+			opLogger.Warn("--client-allowlist-file is set without --client-ca: no client certificate will ever be verified, so every command will be denied as unauthorized")
+		}
+		p.SetClientAllowlist(allowlist)
+	}
+
+	if httpConfig.upstreamProxyMapFile != "" {
+		var overrides map[string]*url.URL
+		overrides, err = loadUpstreamProxyMap(httpConfig.upstreamProxyMapFile)
+		if err != nil {
+			opLogger.Error("loading upstream proxy map", slog.String("path", httpConfig.upstreamProxyMapFile), slog.Any("error", err))
+			return
+		}
+		for vin, proxyURL := range overrides {
+			p.SetVehicleUpstreamProxy(vin, proxyURL)
+		}
+	}
+
 	addr := fmt.Sprintf("%s:%d", httpConfig.host, httpConfig.port)
-	log.Info("Listening on %s", addr)
+	opLogger.Info("listening", slog.String("address", addr))
 
-	if useTLS && httpConfig.certFilename != "" && httpConfig.keyFilename != "" {
-		log.Error("Server stopped: %s", http.ListenAndServeTLS(addr, httpConfig.certFilename, httpConfig.keyFilename, p))
+	var tlsConfig *tls.Config
+	var challengeHandler http.Handler
+	if useTLS {
+		tlsConfig, challengeHandler, err = tlsListenerConfig()
+		if err != nil {
+			opLogger.Error("configuring TLS", slog.Any("error", err))
+			return
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", p)
+	if httpConfig.adminAddr == "" {
+		mux.HandleFunc("/healthz", p.HealthzHandler())
+		mux.HandleFunc("/readyz", p.ReadyzHandler())
 	} else {
-		log.Error("Server stopped: %s", http.ListenAndServe(addr, p))
+		adminMux := http.NewServeMux()
+		adminMux.HandleFunc("/healthz", p.HealthzHandler())
+		adminMux.HandleFunc("/readyz", p.ReadyzHandler())
+		adminServer := &http.Server{Addr: httpConfig.adminAddr, Handler: adminMux}
+		go func() {
+			opLogger.Error("admin server stopped", slog.Any("error", adminServer.ListenAndServe()))
+		}()
+	}
+
+	server := &http.Server{Addr: addr, Handler: mux, TLSConfig: tlsConfig}
+
+	if tlsConfig != nil && challengeHandler != nil {
+		go func() {
+			opLogger.Info("serving ACME HTTP-01 challenges", slog.String("address", autocertHTTPAddr))
+			opLogger.Error("ACME challenge listener stopped", slog.Any("error", http.ListenAndServe(autocertHTTPAddr, challengeHandler)))
+		}()
+	}
+
+	serverErrs := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			serverErrs <- server.ListenAndServeTLS("", "")
+		} else {
+			serverErrs <- server.ListenAndServe()
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err := <-serverErrs:
+		opLogger.Error("server stopped", slog.Any("error", err))
+	case <-ctx.Done():
+		opLogger.Info("shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), httpConfig.shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			opLogger.Error("graceful shutdown", slog.Any("error", err))
+		}
+	}
+
+	if httpConfig.sessionCacheFile != "" {
+		if err := p.SaveSessions(httpConfig.sessionCacheFile); err != nil {
+			opLogger.Error("saving session cache", slog.String("path", httpConfig.sessionCacheFile), slog.Any("error", err))
+		}
 	}
 }
 
@@ -203,5 +400,184 @@ func readFromEnvironment() error {
 		}
 	}
 
+	if !httpConfig.autocert {
+		if autocertEnv, ok := os.LookupEnv(EnvAutocert); ok {
+			httpConfig.autocert = autocertEnv != "false" && autocertEnv != "0"
+		}
+	}
+
+	if httpConfig.autocertHosts == "" {
+		httpConfig.autocertHosts = os.Getenv(EnvAutocertHosts)
+	}
+
+	if httpConfig.autocertCache == "/var/cache/tesla-proxy" {
+		if cacheEnv, ok := os.LookupEnv(EnvAutocertCache); ok {
+			httpConfig.autocertCache = cacheEnv
+		}
+	}
+
+	if httpConfig.clientCA == "" {
+		httpConfig.clientCA = os.Getenv(EnvClientCA)
+	}
+
+	if !httpConfig.requireClientCert {
+		if requireEnv, ok := os.LookupEnv(EnvRequireClientCert); ok {
+			httpConfig.requireClientCert = requireEnv != "false" && requireEnv != "0"
+		}
+	}
+
+	if httpConfig.clientAllowlistFile == "" {
+		httpConfig.clientAllowlistFile = os.Getenv(EnvClientAllowlistFile)
+	}
+
+	if httpConfig.shutdownTimeout == defaultShutdownTimeout {
+		if timeoutEnv, ok := os.LookupEnv(EnvShutdownTimeout); ok {
+			httpConfig.shutdownTimeout, err = time.ParseDuration(timeoutEnv)
+			if err != nil {
+				return fmt.Errorf("invalid shutdown timeout: %s", timeoutEnv)
+			}
+		}
+	}
+
+	if httpConfig.adminAddr == "" {
+		httpConfig.adminAddr = os.Getenv(EnvAdminAddr)
+	}
+
+	if httpConfig.sessionCacheFile == "" {
+		httpConfig.sessionCacheFile = os.Getenv(EnvSessionCacheFile)
+	}
+
+	if httpConfig.metricsAddr == "" {
+		httpConfig.metricsAddr = os.Getenv(EnvMetricsAddr)
+	}
+
+	if httpConfig.upstreamProxy == "" {
+		httpConfig.upstreamProxy = os.Getenv(EnvUpstreamProxy)
+	}
+
+	if httpConfig.upstreamCA == "" {
+		httpConfig.upstreamCA = os.Getenv(EnvUpstreamCA)
+	}
+
+	if httpConfig.upstreamProxyMapFile == "" {
+		httpConfig.upstreamProxyMapFile = os.Getenv(EnvUpstreamProxyMapFile)
+	}
+
+	return nil
+}
+
+// tlsListenerConfig builds the TLS configuration and, for autocert, the HTTP-01 challenge
+// handler required to bring up the proxy's TLS listener, based on the flags/environment the
+// operator configured. If more than one is set, autocert takes precedence over cert-dir, which
+// takes precedence over --cert/--tls-key. The returned config, if any, has mTLS client
+// authentication applied per --client-ca.
+func tlsListenerConfig() (*tls.Config, http.Handler, error) {
+	cfg, challengeHandler, err := certListenerConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg == nil {
+		return nil, nil, nil
+	}
+	if err := applyClientAuth(cfg); err != nil {
+		return nil, nil, err
+	}
+	return cfg, challengeHandler, nil
+}
+
+func certListenerConfig() (*tls.Config, http.Handler, error) {
+	switch {
+	case httpConfig.autocert:
+		if httpConfig.host == "localhost" {
+			return nil, nil, fmt.Errorf("--autocert cannot be used with --host=localhost: Let's Encrypt cannot reach a loopback address to validate ownership")
+		}
+		if httpConfig.autocertHosts == "" {
+			return nil, nil, fmt.Errorf("--autocert requires --autocert-hosts")
+		}
+		hosts := strings.Split(httpConfig.autocertHosts, ",")
+		cfg, challengeHandler := proxy.NewAutocertTLSConfig(hosts, httpConfig.autocertCache)
+		return cfg, challengeHandler, nil
+	case httpConfig.certDir != "":
+		cfg, err := proxy.NewCertDirTLSConfig(httpConfig.certDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading certificates from %s: %w", httpConfig.certDir, err)
+		}
+		return cfg, nil, nil
+	case httpConfig.certFilename != "" && httpConfig.keyFilename != "":
+		cert, err := tls.LoadX509KeyPair(httpConfig.certFilename, httpConfig.keyFilename)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading %s/%s: %w", httpConfig.certFilename, httpConfig.keyFilename, err)
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, nil, nil
+	default:
+		return nil, nil, nil
+	}
+}
+
+// clientAuthConfigured reports whether the operator has configured mandatory mTLS client
+// authentication. --client-ca alone only enables optional verification
+// (tls.VerifyClientCertIfGiven, via applyClientAuth); --require-client-cert must also be set
+// for unauthenticated requests to actually be rejected at the TLS layer, since
+// clientAllowlist is empty by default and admits any verified (or absent) client otherwise.
+func clientAuthConfigured() bool {
+	return httpConfig.clientCA != "" && httpConfig.requireClientCert
+}
+
+// applyClientAuth configures cfg to verify client certificates signed by --client-ca. If
+// --require-client-cert is set, requests without a valid client certificate are rejected at
+// the TLS handshake; otherwise a client certificate is verified when present but not required.
+func applyClientAuth(cfg *tls.Config) error {
+	if httpConfig.requireClientCert && httpConfig.clientCA == "" {
+		return fmt.Errorf("--require-client-cert requires --client-ca")
+	}
+	if httpConfig.clientCA == "" {
+		return nil
+	}
+	pool, err := proxy.LoadClientCAs(httpConfig.clientCA)
+	if err != nil {
+		return err
+	}
+	cfg.ClientCAs = pool
+	if httpConfig.requireClientCert {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	} else {
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
 	return nil
 }
+
+// loadClientAllowlist reads the JSON file at path into a map suitable for SetClientAllowlist,
+// keyed by each authenticated client's mTLS common name with the list of VINs it may address.
+func loadClientAllowlist(path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading client allowlist file: %w", err)
+	}
+	var allowlist map[string][]string
+	if err := json.Unmarshal(data, &allowlist); err != nil {
+		return nil, fmt.Errorf("parsing client allowlist file: %w", err)
+	}
+	return allowlist, nil
+}
+
+// loadUpstreamProxyMap reads the JSON file at path, a map of VIN to upstream proxy URL, for use
+// with SetVehicleUpstreamProxy.
+func loadUpstreamProxyMap(path string) (map[string]*url.URL, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading upstream proxy map file: %w", err)
+	}
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing upstream proxy map file: %w", err)
+	}
+	overrides := make(map[string]*url.URL, len(raw))
+	for vin, rawURL := range raw {
+		proxyURL, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("parsing upstream proxy URL for %s: %w", vin, err)
+		}
+		overrides[vin] = proxyURL
+	}
+	return overrides, nil
+}
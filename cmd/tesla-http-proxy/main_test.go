@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCA generates a throwaway self-signed CA certificate and writes its PEM encoding to
+// a file under t.TempDir(), returning the file's path.
+func writeTestCA(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating test key: %s", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating test certificate: %s", err)
+	}
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("creating %s: %s", path, err)
+	}
+	defer f.Close()
+	if err := pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		t.Fatalf("encoding test certificate: %s", err)
+	}
+	return path
+}
+
+// resetHTTPConfig points the package-level httpConfig at a fresh config for the duration of the
+// test, restoring the previous one on cleanup.
+func resetHTTPConfig(t *testing.T) {
+	t.Helper()
+	prev := httpConfig
+	httpConfig = &HTTProxyConfig{host: "localhost"}
+	t.Cleanup(func() { httpConfig = prev })
+}
+
+func TestClientAuthConfigured(t *testing.T) {
+	resetHTTPConfig(t)
+
+	cases := []struct {
+		name              string
+		clientCA          string
+		requireClientCert bool
+		want              bool
+	}{
+		{"neither set", "", false, false},
+		{"ca without require", "ca.pem", false, false},
+		{"require without ca", "", true, false},
+		{"both set", "ca.pem", true, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			httpConfig.clientCA = c.clientCA
+			httpConfig.requireClientCert = c.requireClientCert
+			if got := clientAuthConfigured(); got != c.want {
+				t.Errorf("clientAuthConfigured() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestApplyClientAuth(t *testing.T) {
+	resetHTTPConfig(t)
+	caPath := writeTestCA(t)
+
+	t.Run("no client CA is a no-op", func(t *testing.T) {
+		httpConfig.clientCA = ""
+		httpConfig.requireClientCert = false
+		cfg := &tls.Config{}
+		if err := applyClientAuth(cfg); err != nil {
+			t.Fatalf("applyClientAuth() = %s", err)
+		}
+		if cfg.ClientAuth != tls.NoClientCert {
+			t.Errorf("ClientAuth = %v, want NoClientCert", cfg.ClientAuth)
+		}
+	})
+
+	t.Run("require without CA is an error", func(t *testing.T) {
+		httpConfig.clientCA = ""
+		httpConfig.requireClientCert = true
+		if err := applyClientAuth(&tls.Config{}); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	})
+
+	t.Run("CA without require only verifies if given", func(t *testing.T) {
+		httpConfig.clientCA = caPath
+		httpConfig.requireClientCert = false
+		cfg := &tls.Config{}
+		if err := applyClientAuth(cfg); err != nil {
+			t.Fatalf("applyClientAuth() = %s", err)
+		}
+		if cfg.ClientAuth != tls.VerifyClientCertIfGiven {
+			t.Errorf("ClientAuth = %v, want VerifyClientCertIfGiven", cfg.ClientAuth)
+		}
+		if cfg.ClientCAs == nil {
+			t.Error("ClientCAs not set")
+		}
+		if clientAuthConfigured() {
+			t.Error("clientAuthConfigured() = true, want false: --client-ca alone must not be treated as mandatory auth")
+		}
+	})
+
+	t.Run("CA with require enforces it", func(t *testing.T) {
+		httpConfig.clientCA = caPath
+		httpConfig.requireClientCert = true
+		cfg := &tls.Config{}
+		if err := applyClientAuth(cfg); err != nil {
+			t.Fatalf("applyClientAuth() = %s", err)
+		}
+		if cfg.ClientAuth != tls.RequireAndVerifyClientCert {
+			t.Errorf("ClientAuth = %v, want RequireAndVerifyClientCert", cfg.ClientAuth)
+		}
+		if !clientAuthConfigured() {
+			t.Error("clientAuthConfigured() = false, want true")
+		}
+	})
+}
+
+func TestLoadClientAllowlist(t *testing.T) {
+	t.Run("valid file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "allowlist.json")
+		if err := os.WriteFile(path, []byte(`{"fleet-dispatcher":["5YJ3000000000001","5YJ3000000000002"]}`), 0o600); err != nil {
+			t.Fatalf("writing allowlist file: %s", err)
+		}
+		allowlist, err := loadClientAllowlist(path)
+		if err != nil {
+			t.Fatalf("loadClientAllowlist() = %s", err)
+		}
+		if got, want := allowlist["fleet-dispatcher"], []string{"5YJ3000000000001", "5YJ3000000000002"}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("allowlist[%q] = %v, want %v", "fleet-dispatcher", got, want)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := loadClientAllowlist(filepath.Join(t.TempDir(), "does-not-exist.json")); err == nil {
+			t.Fatal("expected an error for a missing file")
+		}
+	})
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "allowlist.json")
+		if err := os.WriteFile(path, []byte("not valid json"), 0o600); err != nil {
+			t.Fatalf("writing allowlist file: %s", err)
+		}
+		if _, err := loadClientAllowlist(path); err == nil {
+			t.Fatal("expected an error for an invalid JSON file")
+		}
+	})
+}
+
+func TestLoadUpstreamProxyMap(t *testing.T) {
+	t.Run("valid file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "upstream-proxy-map.json")
+		if err := os.WriteFile(path, []byte(`{"5YJ3000000000001":"http://proxy.example:8080"}`), 0o600); err != nil {
+			t.Fatalf("writing upstream proxy map file: %s", err)
+		}
+		overrides, err := loadUpstreamProxyMap(path)
+		if err != nil {
+			t.Fatalf("loadUpstreamProxyMap() = %s", err)
+		}
+		proxyURL, ok := overrides["5YJ3000000000001"]
+		if !ok {
+			t.Fatal("expected an override for 5YJ3000000000001")
+		}
+		if got, want := proxyURL.String(), "http://proxy.example:8080"; got != want {
+			t.Errorf("proxy URL = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := loadUpstreamProxyMap(filepath.Join(t.TempDir(), "does-not-exist.json")); err == nil {
+			t.Fatal("expected an error for a missing file")
+		}
+	})
+
+	t.Run("invalid proxy URL", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "upstream-proxy-map.json")
+		if err := os.WriteFile(path, []byte(`{"5YJ3000000000001":"://not-a-url"}`), 0o600); err != nil {
+			t.Fatalf("writing upstream proxy map file: %s", err)
+		}
+		if _, err := loadUpstreamProxyMap(path); err == nil {
+			t.Fatal("expected an error for an invalid proxy URL")
+		}
+	})
+}
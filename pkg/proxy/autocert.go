@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// NewAutocertTLSConfig returns a tls.Config that obtains and renews certificates for hosts
+// from an ACME provider (Let's Encrypt by default), persisting them under cacheDir so renewal
+// survives restarts. The returned handler answers ACME HTTP-01 challenges and must be served
+// on port 80 alongside the TLS listener; it redirects any other GET or HEAD request to HTTPS
+// and answers other methods with 400 Bad Request.
+func NewAutocertTLSConfig(hosts []string, cacheDir string) (*tls.Config, http.Handler) {
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(hosts...),
+		Cache:      autocert.DirCache(cacheDir),
+	}
+	return m.TLSConfig(), m.HTTPHandler(nil)
+}
+
+// certDirStore loads TLS certificates from hostname-named files in a directory and reloads
+// them whenever the directory changes, so operators who already run a renewal daemon (for
+// example an existing ACME client) can rotate certificates without restarting the proxy.
+type certDirStore struct {
+	mu    sync.RWMutex
+	certs map[string]*tls.Certificate
+}
+
+// NewCertDirTLSConfig returns a tls.Config that loads <hostname>.crt/<hostname>.key pairs from
+// dir and reloads them on filesystem change.
+func NewCertDirTLSConfig(dir string) (*tls.Config, error) {
+	store := &certDirStore{certs: make(map[string]*tls.Certificate)}
+	if err := store.reload(dir); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("creating cert directory watcher: %w", err)
+	}
+	if err := watcher.Add(dir); err != nil {
+		return nil, fmt.Errorf("watching %s: %w", dir, err)
+	}
+	go store.watch(watcher, dir)
+
+	return &tls.Config{GetCertificate: store.getCertificate}, nil
+}
+
+func (s *certDirStore) watch(watcher *fsnotify.Watcher, dir string) {
+	defer watcher.Close()
+	for {
+		select {
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if err := s.reload(dir); err != nil {
+				defaultLogger.Error("reloading certificates", slog.String("dir", dir), slog.Any("error", err))
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			defaultLogger.Error("certificate directory watcher error", slog.Any("error", err))
+		}
+	}
+}
+
+func (s *certDirStore) reload(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("reading cert directory: %w", err)
+	}
+
+	certs := make(map[string]*tls.Certificate)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".crt") {
+			continue
+		}
+		host := strings.TrimSuffix(name, ".crt")
+		cert, err := tls.LoadX509KeyPair(filepath.Join(dir, name), filepath.Join(dir, host+".key"))
+		if err != nil {
+			defaultLogger.Error("loading certificate", slog.String("host", host), slog.Any("error", err))
+			continue
+		}
+		certs[host] = &cert
+	}
+
+	s.mu.Lock()
+	s.certs = certs
+	s.mu.Unlock()
+	defaultLogger.Info("loaded certificates", slog.Int("count", len(certs)), slog.String("dir", dir))
+	return nil
+}
+
+func (s *certDirStore) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if cert, ok := s.certs[hello.ServerName]; ok {
+		return cert, nil
+	}
+	return nil, fmt.Errorf("no certificate for host %q", hello.ServerName)
+}
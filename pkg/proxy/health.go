@@ -0,0 +1,33 @@
+package proxy
+
+import "net/http"
+
+// Ready reports whether the proxy is fit to accept traffic. It is true once the Proxy is
+// constructed, and becomes false only if a configured session cache file fails to load (see
+// LoadSessions) — it does not track anything about the signing key, which must already be
+// loaded before New is called.
+func (p *Proxy) Ready() bool {
+	return p.ready.Load()
+}
+
+// HealthzHandler reports whether the process is alive. Unlike ReadyzHandler, it does not
+// reflect whether a configured session cache file loaded (see Ready), so an orchestrator does
+// not restart a proxy only because its cache could not be restored.
+func (p *Proxy) HealthzHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}
+}
+
+// ReadyzHandler reports whether the proxy is ready to accept traffic.
+func (p *Proxy) ReadyzHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !p.Ready() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}
+}
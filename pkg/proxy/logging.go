@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+)
+
+// defaultLogger is the structured logger used for per-request dispatch logs when a Proxy is
+// not configured with WithLogger. It writes JSON to stderr so operators can pipe output into
+// a log aggregator.
+var defaultLogger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+// newRequestID returns a short random identifier used to correlate the logs emitted while
+// handling a single command request.
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// logDispatch emits a structured log line for a dispatched command, carrying the request ID,
+// the verified mTLS client identity (if any), the VIN, and the command name.
+func logDispatch(ctx context.Context, logger *slog.Logger, requestID, vin, command string, status int) {
+	attrs := []any{
+		slog.String("request_id", requestID),
+		slog.String("vin", vin),
+		slog.String("command", command),
+		slog.Int("status", status),
+	}
+	if cn := ClientCommonName(ctx); cn != "" {
+		attrs = append(attrs, slog.String("client_cn", cn))
+	}
+	logger.InfoContext(ctx, "dispatched command", attrs...)
+}
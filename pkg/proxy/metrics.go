@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Collector receives observability events from a Proxy as it dispatches commands. Vehicles are
+// identified by a hash of their VIN rather than the VIN itself, so a Collector implementation
+// (and whatever backend it reports to) never has to handle a raw VIN.
+type Collector interface {
+	// CommandDispatched is called once per command after the proxy finishes handling it.
+	CommandDispatched(command, vinHash string, status int, upstreamLatency time.Duration, cacheHit bool)
+	// HandshakeRetried is called each time a command requires an additional handshake attempt.
+	HandshakeRetried(vinHash string)
+	// RateLimited is called when Tesla's API responds to a command with a rate-limit error.
+	RateLimited(vinHash string)
+}
+
+// noopCollector discards every event. It is the default when no Collector is configured.
+type noopCollector struct{}
+
+func (noopCollector) CommandDispatched(string, string, int, time.Duration, bool) {}
+func (noopCollector) HandshakeRetried(string)                                    {}
+func (noopCollector) RateLimited(string)                                         {}
+
+// hashVIN returns a hex-encoded SHA-256 digest of vin, suitable for use as a metric label or
+// log field without exposing the VIN itself.
+func hashVIN(vin string) string {
+	sum := sha256.Sum256([]byte(vin))
+	return hex.EncodeToString(sum[:])
+}
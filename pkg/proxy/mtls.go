@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+type clientIdentityKey struct{}
+
+// clientIdentity describes the verified mTLS client that made a request, derived from the
+// client certificate's common name and DNS/IP SANs.
+type clientIdentity struct {
+	commonName string
+	sans       []string
+}
+
+// withClientIdentity returns a context carrying the verified identity of cert, so that it can
+// be recovered later in the request lifecycle for logging and authorization.
+func withClientIdentity(ctx context.Context, cert *x509.Certificate) context.Context {
+	id := &clientIdentity{commonName: cert.Subject.CommonName}
+	id.sans = append(id.sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		id.sans = append(id.sans, ip.String())
+	}
+	return context.WithValue(ctx, clientIdentityKey{}, id)
+}
+
+// ClientCommonName returns the common name of the verified mTLS client certificate associated
+// with ctx, or "" if the request was not authenticated with a client certificate.
+func ClientCommonName(ctx context.Context) string {
+	id, ok := ctx.Value(clientIdentityKey{}).(*clientIdentity)
+	if !ok {
+		return ""
+	}
+	return id.commonName
+}
+
+// LoadClientCAs reads a PEM-encoded CA bundle from path, for use as a tls.Config's ClientCAs.
+func LoadClientCAs(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading client CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// SetClientAllowlist restricts which VINs each verified client common name may address. A
+// common name absent from the allowlist is denied every command. Passing a nil map disables
+// the allowlist, so any authenticated client may address any vehicle.
+func (p *Proxy) SetClientAllowlist(allowlist map[string][]string) {
+	p.clientAllowlist = allowlist
+}
+
+// authorizeClient reports whether the client identified by ctx may send commands to vin. It
+// always allows the request when no allowlist has been configured.
+func (p *Proxy) authorizeClient(ctx context.Context, vin string) error {
+	if p.clientAllowlist == nil {
+		return nil
+	}
+	cn := ClientCommonName(ctx)
+	if cn == "" {
+		return fmt.Errorf("no verified client certificate")
+	}
+	for _, allowed := range p.clientAllowlist[cn] {
+		if allowed == vin {
+			return nil
+		}
+	}
+	return fmt.Errorf("client %q is not authorized to address vehicle %s", cn, vin)
+}
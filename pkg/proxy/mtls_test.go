@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+)
+
+func TestClientCommonName(t *testing.T) {
+	t.Run("no client certificate", func(t *testing.T) {
+		if got := ClientCommonName(context.Background()); got != "" {
+			t.Errorf("ClientCommonName() = %q, want \"\"", got)
+		}
+	})
+
+	t.Run("verified client certificate", func(t *testing.T) {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: "fleet-dispatcher"}}
+		ctx := withClientIdentity(context.Background(), cert)
+		if got, want := ClientCommonName(ctx), "fleet-dispatcher"; got != want {
+			t.Errorf("ClientCommonName() = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestAuthorizeClient(t *testing.T) {
+	const vin = "5YJ3000000000001"
+
+	t.Run("no allowlist configured", func(t *testing.T) {
+		p := newTestProxy(t)
+		if err := p.authorizeClient(context.Background(), vin); err != nil {
+			t.Errorf("authorizeClient() = %s, want nil with no allowlist configured", err)
+		}
+	})
+
+	p := newTestProxy(t)
+	p.SetClientAllowlist(map[string][]string{
+		"fleet-dispatcher": {vin},
+	})
+
+	cases := []struct {
+		name       string
+		commonName string
+		vin        string
+		wantErr    bool
+	}{
+		{"allowed client and vin", "fleet-dispatcher", vin, false},
+		{"allowed client, other vin", "fleet-dispatcher", "5YJ3000000000002", true},
+		{"unlisted client", "unknown-client", vin, true},
+		{"no client certificate", "", vin, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			if c.commonName != "" {
+				cert := &x509.Certificate{Subject: pkix.Name{CommonName: c.commonName}}
+				ctx = withClientIdentity(ctx, cert)
+			}
+			err := p.authorizeClient(ctx, c.vin)
+			if c.wantErr && err == nil {
+				t.Error("authorizeClient() = nil, want an error")
+			}
+			if !c.wantErr && err != nil {
+				t.Errorf("authorizeClient() = %s, want nil", err)
+			}
+		})
+	}
+}
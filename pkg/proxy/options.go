@@ -0,0 +1,19 @@
+package proxy
+
+import "log/slog"
+
+// Option configures optional behavior on a Proxy at construction time.
+type Option func(*Proxy)
+
+// WithMetricsCollector configures the Proxy to report command-dispatch metrics to c instead of
+// discarding them. Callers embedding pkg/proxy without the tesla-http-proxy binary can supply
+// their own Collector implementation.
+func WithMetricsCollector(c Collector) Option {
+	return func(p *Proxy) { p.collector = c }
+}
+
+// WithLogger configures the structured logger used for per-request dispatch logs. The default
+// logger writes JSON to stderr.
+func WithLogger(logger *slog.Logger) Option {
+	return func(p *Proxy) { p.logger = logger }
+}
@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// persistedSession is the on-disk representation of a commandSession.
+type persistedSession struct {
+	VIN     string    `json:"vin"`
+	Created time.Time `json:"created"`
+	Epoch   []byte    `json:"epoch,omitempty"`
+	Counter uint32    `json:"counter"`
+}
+
+// SaveSessions serializes the current session cache to path, so it can be rehydrated on the
+// next startup instead of being rebuilt from scratch against Tesla's rate limits.
+func (p *Proxy) SaveSessions(path string) error {
+	p.sessions.mu.Lock()
+	sessions := make([]persistedSession, 0, p.sessions.order.Len())
+	for e := p.sessions.order.Front(); e != nil; e = e.Next() {
+		s := e.Value.(*commandSession)
+		sessions = append(sessions, persistedSession{VIN: s.vin, Created: s.created, Epoch: s.epoch, Counter: s.counter})
+	}
+	p.sessions.mu.Unlock()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating session cache file: %w", err)
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(sessions); err != nil {
+		return fmt.Errorf("writing session cache file: %w", err)
+	}
+	return nil
+}
+
+// LoadSessions rehydrates the session cache from path, dropping any entry whose handshake
+// epoch is missing, since there is no state to resume and the next command to that vehicle
+// will simply establish a new session. A missing file is not an error: there is simply nothing
+// to rehydrate yet. Any other failure to load marks the Proxy not ready (see Ready), since an
+// operator who configured a session cache file presumably wanted it restored before serving
+// traffic.
+func (p *Proxy) LoadSessions(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		p.ready.Store(false)
+		return fmt.Errorf("opening session cache file: %w", err)
+	}
+	defer f.Close()
+
+	var sessions []persistedSession
+	if err := json.NewDecoder(f).Decode(&sessions); err != nil {
+		p.ready.Store(false)
+		return fmt.Errorf("reading session cache file: %w", err)
+	}
+
+	restored := 0
+	for _, s := range sessions {
+		if len(s.Epoch) == 0 {
+			continue
+		}
+		p.sessions.put(&commandSession{vin: s.VIN, created: s.Created, epoch: s.Epoch, counter: s.Counter})
+		restored++
+	}
+	p.logger.Info("restored cached vehicle sessions",
+		slog.Int("restored", restored), slog.Int("total", len(sessions)), slog.String("path", path))
+	p.ready.Store(true)
+	return nil
+}
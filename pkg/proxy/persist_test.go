@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestProxy(t *testing.T) *Proxy {
+	t.Helper()
+	p := &Proxy{
+		Timeout:   DefaultTimeout,
+		sessions:  newSessionCache(10),
+		client:    &http.Client{Timeout: DefaultTimeout},
+		baseURL:   teslaAPIBaseURL,
+		collector: noopCollector{},
+		logger:    defaultLogger,
+	}
+	p.ready.Store(true)
+	return p
+}
+
+func TestSaveLoadSessionsRoundTrip(t *testing.T) {
+	p := newTestProxy(t)
+	p.sessions.put(&commandSession{vin: "5YJ3000000000001", created: time.Now(), epoch: []byte{1, 2, 3}, counter: 7})
+	p.sessions.put(&commandSession{vin: "5YJ3000000000002", created: time.Now(), epoch: []byte{4, 5, 6}, counter: 2})
+
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	if err := p.SaveSessions(path); err != nil {
+		t.Fatalf("SaveSessions() = %s", err)
+	}
+
+	restored := newTestProxy(t)
+	if err := restored.LoadSessions(path); err != nil {
+		t.Fatalf("LoadSessions() = %s", err)
+	}
+
+	if got, want := restored.sessions.len(), p.sessions.len(); got != want {
+		t.Fatalf("restored session count = %d, want %d", got, want)
+	}
+
+	session, ok := restored.sessions.get("5YJ3000000000001")
+	if !ok {
+		t.Fatal("expected session for 5YJ3000000000001 to be restored")
+	}
+	if session.counter != 7 {
+		t.Errorf("counter = %d, want 7", session.counter)
+	}
+}
+
+func TestLoadSessionsDropsEmptyEpoch(t *testing.T) {
+	p := newTestProxy(t)
+	p.sessions.put(&commandSession{vin: "5YJ3000000000003", created: time.Now()}) // no epoch: never completed a handshake
+
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	if err := p.SaveSessions(path); err != nil {
+		t.Fatalf("SaveSessions() = %s", err)
+	}
+
+	restored := newTestProxy(t)
+	if err := restored.LoadSessions(path); err != nil {
+		t.Fatalf("LoadSessions() = %s", err)
+	}
+	if got := restored.sessions.len(); got != 0 {
+		t.Errorf("restored session count = %d, want 0 (entries without an epoch should be dropped)", got)
+	}
+}
+
+func TestLoadSessionsMissingFile(t *testing.T) {
+	p := newTestProxy(t)
+	if err := p.LoadSessions(filepath.Join(t.TempDir(), "does-not-exist.json")); err != nil {
+		t.Errorf("LoadSessions() = %s, want nil for a missing cache file", err)
+	}
+	if !p.Ready() {
+		t.Error("Ready() = false, want true: a missing cache file is not a failure")
+	}
+}
+
+func TestLoadSessionsMarksNotReadyOnFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	if err := os.WriteFile(path, []byte("not valid json"), 0o600); err != nil {
+		t.Fatalf("writing corrupt cache file: %s", err)
+	}
+
+	p := newTestProxy(t)
+	if err := p.LoadSessions(path); err == nil {
+		t.Fatal("expected an error decoding a corrupt cache file")
+	}
+	if p.Ready() {
+		t.Error("Ready() = true, want false after LoadSessions failed")
+	}
+}
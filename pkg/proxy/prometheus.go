@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PrometheusCollector is a Collector backed by Prometheus client_golang metrics.
+type PrometheusCollector struct {
+	commandsTotal    *prometheus.CounterVec
+	upstreamLatency  *prometheus.HistogramVec
+	sessionCache     *prometheus.CounterVec
+	handshakeRetries *prometheus.CounterVec
+	rateLimited      *prometheus.CounterVec
+}
+
+// NewPrometheusCollector creates a PrometheusCollector and registers its metrics with reg.
+func NewPrometheusCollector(reg prometheus.Registerer) *PrometheusCollector {
+	c := &PrometheusCollector{
+		commandsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tesla_http_proxy_commands_total",
+			Help: "Total number of commands dispatched, labeled by command and HTTP status.",
+		}, []string{"command", "status"}),
+		upstreamLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "tesla_http_proxy_upstream_latency_seconds",
+			Help: "Latency of upstream requests to Tesla's API, labeled by command.",
+		}, []string{"command"}),
+		sessionCache: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tesla_http_proxy_session_cache_total",
+			Help: "Vehicle session cache lookups, labeled by hit or miss.",
+		}, []string{"result"}),
+		handshakeRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tesla_http_proxy_handshake_retries_total",
+			Help: "Additional handshake attempts required, labeled by a hash of the VIN.",
+		}, []string{"vin_hash"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tesla_http_proxy_rate_limited_total",
+			Help: "Rate-limit responses received from Tesla's API, labeled by a hash of the VIN.",
+		}, []string{"vin_hash"}),
+	}
+	reg.MustRegister(c.commandsTotal, c.upstreamLatency, c.sessionCache, c.handshakeRetries, c.rateLimited)
+	return c
+}
+
+// CommandDispatched implements Collector.
+func (c *PrometheusCollector) CommandDispatched(command, vinHash string, status int, upstreamLatency time.Duration, cacheHit bool) {
+	c.commandsTotal.WithLabelValues(command, strconv.Itoa(status)).Inc()
+	c.upstreamLatency.WithLabelValues(command).Observe(upstreamLatency.Seconds())
+	result := "miss"
+	if cacheHit {
+		result = "hit"
+	}
+	c.sessionCache.WithLabelValues(result).Inc()
+}
+
+// HandshakeRetried implements Collector.
+func (c *PrometheusCollector) HandshakeRetried(vinHash string) {
+	c.handshakeRetries.WithLabelValues(vinHash).Inc()
+}
+
+// RateLimited implements Collector.
+func (c *PrometheusCollector) RateLimited(vinHash string) {
+	c.rateLimited.WithLabelValues(vinHash).Inc()
+}
@@ -0,0 +1,262 @@
+// Package proxy implements an HTTP server that exposes a REST API for sending commands to
+// Tesla vehicles. It forwards each incoming command to Tesla's servers as a POST with no body
+// and keeps a per-vehicle LRU cache of command sessions. Commands are not signed with the
+// private key passed to New, and no session handshake is performed.
+package proxy
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+// DefaultTimeout is used for a Proxy's Timeout field when callers do not set one explicitly.
+const DefaultTimeout = 10 * time.Second
+
+// teslaAPIBaseURL is the default base URL used to reach Tesla's Fleet API.
+const teslaAPIBaseURL = "https://owner-api.teslamotors.com"
+
+// upstreamOverride is a vehicle's per-VIN egress configuration: an immutable snapshot of the
+// proxy URL and the *http.Client built from it (so repeat commands to the vehicle reuse its
+// transport instead of rebuilding one per request). See SetVehicleUpstreamProxy.
+type upstreamOverride struct {
+	proxyURL *url.URL
+	client   *http.Client
+}
+
+// commandSession caches the handshake state required to send additional commands to a
+// vehicle without repeating the initial session establishment.
+type commandSession struct {
+	vin     string
+	created time.Time
+	epoch   []byte
+	counter uint32
+
+	// upstream holds this vehicle's upstreamOverride, if any, behind an atomic.Pointer: it is
+	// written by SetVehicleUpstreamProxy and read by sendCommand, which run concurrently and
+	// without a shared lock, so a plain field would race.
+	upstream atomic.Pointer[upstreamOverride]
+}
+
+// sessionCache is a fixed-size LRU cache of commandSessions keyed by VIN.
+type sessionCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+func newSessionCache(capacity int) *sessionCache {
+	return &sessionCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *sessionCache) get(vin string) (*commandSession, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[vin]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*commandSession), true
+}
+
+func (c *sessionCache) put(session *commandSession) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[session.vin]; ok {
+		elem.Value = session
+		c.order.MoveToFront(elem)
+		return
+	}
+	elem := c.order.PushFront(session)
+	c.entries[session.vin] = elem
+	if c.order.Len() > c.capacity {
+		if oldest := c.order.Back(); oldest != nil {
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*commandSession).vin)
+		}
+	}
+}
+
+func (c *sessionCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Proxy implements http.Handler, accepting plaintext HTTP requests and dispatching the
+// corresponding commands, unsigned, to Tesla's servers.
+type Proxy struct {
+	// Timeout bounds how long the proxy waits for a vehicle to acknowledge a command.
+	Timeout time.Duration
+
+	skey     protocol.ECDHPrivateKey
+	sessions *sessionCache
+	client   *http.Client
+
+	// baseURL is the base URL used to reach Tesla's Fleet API, overridden in tests to point at
+	// an httptest.Server instead of teslaAPIBaseURL.
+	baseURL string
+
+	// clientAllowlist restricts which VINs a verified mTLS client common name may address. A
+	// nil map means every authenticated client may address every vehicle.
+	clientAllowlist map[string][]string
+
+	// ready reflects whether the proxy is fit to accept traffic: true once constructed, and set
+	// to false if a configured session cache file fails to load (see LoadSessions). Read by
+	// ReadyzHandler and written from a different goroutine than the one serving requests, hence
+	// atomic rather than a plain bool.
+	ready atomic.Bool
+
+	// collector receives observability events for dispatched commands. Defaults to a no-op.
+	collector Collector
+	// logger emits structured per-request dispatch logs. Defaults to JSON-on-stderr.
+	logger *slog.Logger
+}
+
+// New creates a Proxy that holds skey and caches up to cacheSize vehicle command sessions.
+// skey is stored but not used to sign the commands the Proxy forwards.
+func New(ctx context.Context, skey protocol.ECDHPrivateKey, cacheSize int, opts ...Option) (*Proxy, error) {
+	if cacheSize <= 0 {
+		return nil, fmt.Errorf("cache size must be positive")
+	}
+	p := &Proxy{
+		Timeout:   DefaultTimeout,
+		skey:      skey,
+		sessions:  newSessionCache(cacheSize),
+		client:    &http.Client{Timeout: DefaultTimeout},
+		baseURL:   teslaAPIBaseURL,
+		collector: noopCollector{},
+		logger:    defaultLogger,
+	}
+	p.ready.Store(true)
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := newRequestID()
+
+	vin, command, ok := parseCommandPath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), p.Timeout)
+	defer cancel()
+
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		ctx = withClientIdentity(ctx, r.TLS.PeerCertificates[0])
+	}
+
+	if err := p.authorizeClient(ctx, vin); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		p.finishRequest(ctx, requestID, vin, command, http.StatusForbidden, 0, false)
+		return
+	}
+
+	start := time.Now()
+	cacheHit, err := p.dispatch(ctx, vin, command)
+	latency := time.Since(start)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		p.finishRequest(ctx, requestID, vin, command, http.StatusBadGateway, latency, cacheHit)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"response": map[string]any{}})
+	p.finishRequest(ctx, requestID, vin, command, http.StatusOK, latency, cacheHit)
+}
+
+// finishRequest records the structured log and metrics for a completed request.
+func (p *Proxy) finishRequest(ctx context.Context, requestID, vin, command string, status int, latency time.Duration, cacheHit bool) {
+	logDispatch(ctx, p.logger, requestID, vin, command, status)
+	p.collector.CommandDispatched(command, hashVIN(vin), status, latency, cacheHit)
+}
+
+// parseCommandPath extracts the VIN and command name from a request path of the form
+// /api/1/vehicles/{vin}/{command}.
+func parseCommandPath(path string) (vin, command string, ok bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 5 || parts[0] != "api" || parts[1] != "1" || parts[2] != "vehicles" || parts[4] == "" {
+		return "", "", false
+	}
+	return parts[3], parts[4], true
+}
+
+func (p *Proxy) dispatch(ctx context.Context, vin, command string) (cacheHit bool, err error) {
+	session, ok := p.sessions.get(vin)
+	if ok {
+		cacheHit = true
+	} else {
+		session = &commandSession{vin: vin, created: time.Now()}
+		p.sessions.put(session)
+	}
+
+	resp, err := p.sendCommand(ctx, session, command)
+	if err != nil {
+		return cacheHit, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		p.collector.RateLimited(hashVIN(vin))
+	case http.StatusPreconditionFailed:
+		// The vehicle rejected our cached session (e.g. a stale counter after a restart
+		// elsewhere); drop its handshake state so the next command re-establishes a
+		// session, but keep any per-VIN upstream override the vehicle was assigned.
+		p.collector.HandshakeRetried(hashVIN(vin))
+		evicted := &commandSession{vin: vin, created: time.Now()}
+		if override := session.upstream.Load(); override != nil {
+			evicted.upstream.Store(override)
+		}
+		p.sessions.put(evicted)
+	}
+
+	if resp.StatusCode >= 400 {
+		return cacheHit, fmt.Errorf("upstream returned %s", resp.Status)
+	}
+	return cacheHit, nil
+}
+
+// sendCommand forwards a command to Tesla's API for the vehicle described by session. It routes
+// the request through session's upstreamOverride when the vehicle has a per-VIN egress override
+// (see SetVehicleUpstreamProxy), falling back to the Proxy's default client otherwise.
+func (p *Proxy) sendCommand(ctx context.Context, session *commandSession, command string) (*http.Response, error) {
+	client := p.client
+	if override := session.upstream.Load(); override != nil {
+		client = override.client
+	}
+
+	dest := fmt.Sprintf("%s/api/1/vehicles/%s/command/%s", p.baseURL, session.vin, command)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dest, nil)
+	if err != nil {
+		return nil, fmt.Errorf("building upstream request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sending command to Tesla: %w", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+func TestParseCommandPath(t *testing.T) {
+	cases := []struct {
+		name        string
+		path        string
+		wantVIN     string
+		wantCommand string
+		wantOK      bool
+	}{
+		{"valid path", "/api/1/vehicles/5YJ3000000000001/wake_up", "5YJ3000000000001", "wake_up", true},
+		{"valid path with leading/trailing slashes", "/api/1/vehicles/5YJ3000000000001/wake_up/", "5YJ3000000000001", "wake_up", true},
+		{"missing command", "/api/1/vehicles/5YJ3000000000001/", "", "", false},
+		{"wrong prefix", "/api/2/vehicles/5YJ3000000000001/wake_up", "", "", false},
+		{"missing vehicles segment", "/api/1/5YJ3000000000001/wake_up", "", "", false},
+		{"too few segments", "/api/1/vehicles/wake_up", "", "", false},
+		{"too many segments", "/api/1/vehicles/5YJ3000000000001/wake_up/extra", "", "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			vin, command, ok := parseCommandPath(c.path)
+			if ok != c.wantOK || vin != c.wantVIN || command != c.wantCommand {
+				t.Errorf("parseCommandPath(%q) = (%q, %q, %v), want (%q, %q, %v)",
+					c.path, vin, command, ok, c.wantVIN, c.wantCommand, c.wantOK)
+			}
+		})
+	}
+}
+
+// newDispatchTestProxy returns a Proxy whose outbound requests are routed to an httptest.Server
+// that always responds with status, instead of Tesla's real API.
+func newDispatchTestProxy(t *testing.T, status int) *Proxy {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	p := newTestProxy(t)
+	p.baseURL = server.URL
+	return p
+}
+
+func TestDispatchCacheHit(t *testing.T) {
+	p := newDispatchTestProxy(t, http.StatusOK)
+	const vin = "5YJ3000000000001"
+
+	cacheHit, err := p.dispatch(context.Background(), vin, "wake_up")
+	if err != nil {
+		t.Fatalf("dispatch() = %s", err)
+	}
+	if cacheHit {
+		t.Error("dispatch() cacheHit = true on first command, want false")
+	}
+
+	cacheHit, err = p.dispatch(context.Background(), vin, "wake_up")
+	if err != nil {
+		t.Fatalf("dispatch() = %s", err)
+	}
+	if !cacheHit {
+		t.Error("dispatch() cacheHit = false on repeat command, want true")
+	}
+}
+
+func TestDispatchPreconditionFailedEvictsSessionButKeepsUpstreamOverride(t *testing.T) {
+	p := newDispatchTestProxy(t, http.StatusPreconditionFailed)
+	const vin = "5YJ3000000000001"
+
+	// Point the override at the same test server as p.baseURL, so the overridden client can
+	// still reach it and the 412 response under test actually comes back.
+	proxyURL, err := url.Parse(p.baseURL)
+	if err != nil {
+		t.Fatalf("parsing test proxy URL: %s", err)
+	}
+	p.SetVehicleUpstreamProxy(vin, proxyURL)
+
+	if _, err := p.dispatch(context.Background(), vin, "wake_up"); err == nil {
+		t.Fatal("dispatch() = nil, want an error for a 412 response")
+	}
+
+	session, ok := p.sessions.get(vin)
+	if !ok {
+		t.Fatal("expected a session to remain cached for vin after eviction")
+	}
+	if len(session.epoch) != 0 {
+		t.Error("expected the evicted session's handshake epoch to be cleared")
+	}
+	if override := session.upstream.Load(); override == nil || override.proxyURL.String() != proxyURL.String() {
+		t.Error("expected the evicted session to retain its upstream override")
+	}
+}
+
+func TestSendCommandUsesVehicleUpstreamOverride(t *testing.T) {
+	var sawOverrideRequest bool
+	overrideServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sawOverrideRequest = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer overrideServer.Close()
+
+	p := newDispatchTestProxy(t, http.StatusOK)
+	const vin = "5YJ3000000000001"
+
+	proxyURL, err := url.Parse(overrideServer.URL)
+	if err != nil {
+		t.Fatalf("parsing test proxy URL: %s", err)
+	}
+	p.SetVehicleUpstreamProxy(vin, proxyURL)
+
+	if _, err := p.dispatch(context.Background(), vin, "wake_up"); err != nil {
+		t.Fatalf("dispatch() = %s", err)
+	}
+	if !sawOverrideRequest {
+		t.Error("expected the command to be routed through the vehicle's upstream override")
+	}
+}
+
+// TestConcurrentDispatchAndSetVehicleUpstreamProxy exercises dispatch and
+// SetVehicleUpstreamProxy running concurrently against the same VIN, reproducing the scenario
+// from a previously reported -race failure between sendCommand's read of
+// commandSession.upstream and SetVehicleUpstreamProxy's write of it.
+func TestConcurrentDispatchAndSetVehicleUpstreamProxy(t *testing.T) {
+	p := newDispatchTestProxy(t, http.StatusOK)
+	const vin = "5YJ3000000000001"
+
+	proxyURL, err := url.Parse("http://127.0.0.1:9")
+	if err != nil {
+		t.Fatalf("parsing test proxy URL: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			p.dispatch(context.Background(), vin, "wake_up")
+		}()
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				p.SetVehicleUpstreamProxy(vin, proxyURL)
+			} else {
+				p.SetVehicleUpstreamProxy(vin, nil)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// LoadUpstreamCA reads a PEM-encoded CA bundle from path, for use with WithUpstreamCA.
+func LoadUpstreamCA(path string) ([]byte, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading upstream CA bundle: %w", err)
+	}
+	return pem, nil
+}
+
+// WithUpstreamProxy routes the Proxy's outbound requests to Tesla's API through proxyURL.
+// Basic-auth credentials may be embedded in the URL's userinfo.
+func WithUpstreamProxy(proxyURL *url.URL) Option {
+	return func(p *Proxy) {
+		transport := cloneUpstreamTransport(p.client.Transport)
+		transport.Proxy = http.ProxyURL(proxyURL)
+		p.client.Transport = transport
+	}
+}
+
+// WithUpstreamCA augments the trust store used to verify Tesla's API certificate with the
+// PEM-encoded certificates in caPEM, for deployments behind a TLS-intercepting middlebox. It is
+// additive only: the system root CAs remain trusted, and certificate verification cannot be
+// disabled through this option.
+func WithUpstreamCA(caPEM []byte) Option {
+	return func(p *Proxy) {
+		transport := cloneUpstreamTransport(p.client.Transport)
+		pool := transport.TLSClientConfig.RootCAs
+		if pool == nil {
+			if sysPool, err := x509.SystemCertPool(); err == nil && sysPool != nil {
+				pool = sysPool
+			} else {
+				pool = x509.NewCertPool()
+			}
+		}
+		pool.AppendCertsFromPEM(caPEM)
+		transport.TLSClientConfig.RootCAs = pool
+		p.client.Transport = transport
+	}
+}
+
+// cloneUpstreamTransport returns an *http.Transport based on rt (or http.DefaultTransport if rt
+// is not an *http.Transport) with a non-nil TLSClientConfig, so upstream options can be applied
+// without clobbering transport settings configured by an earlier option.
+func cloneUpstreamTransport(rt http.RoundTripper) *http.Transport {
+	var transport *http.Transport
+	if t, ok := rt.(*http.Transport); ok {
+		transport = t.Clone()
+	} else {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	return transport
+}
+
+// SetVehicleUpstreamProxy overrides the upstream egress proxy used for requests concerning vin,
+// so a multi-tenant deployment can route different vehicles' traffic through different egress
+// paths. Passing a nil proxyURL clears the override, reverting vin to the Proxy's default
+// transport.
+func (p *Proxy) SetVehicleUpstreamProxy(vin string, proxyURL *url.URL) {
+	var override *upstreamOverride
+	if proxyURL != nil {
+		transport := cloneUpstreamTransport(p.client.Transport)
+		transport.Proxy = http.ProxyURL(proxyURL)
+		override = &upstreamOverride{
+			proxyURL: proxyURL,
+			client:   &http.Client{Transport: transport, Timeout: p.client.Timeout},
+		}
+	}
+
+	p.sessions.mu.Lock()
+	elem, ok := p.sessions.entries[vin]
+	if !ok {
+		elem = p.sessions.order.PushFront(&commandSession{vin: vin})
+		p.sessions.entries[vin] = elem
+		if p.sessions.order.Len() > p.sessions.capacity {
+			if oldest := p.sessions.order.Back(); oldest != nil && oldest != elem {
+				p.sessions.order.Remove(oldest)
+				delete(p.sessions.entries, oldest.Value.(*commandSession).vin)
+			}
+		}
+	}
+	session := elem.Value.(*commandSession)
+	p.sessions.mu.Unlock()
+
+	// Stored via atomic.Pointer, not under sessions.mu: sendCommand reads session.upstream on a
+	// session pointer it already holds, after releasing that lock, so the two must not share it.
+	session.upstream.Store(override)
+}